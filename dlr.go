@@ -0,0 +1,130 @@
+package smpp34
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// ErrNotDeliveryReceipt is returned by ParseDeliveryReceipt when the
+// given Pdu is not a DeliverSm carrying a delivery receipt.
+var ErrNotDeliveryReceipt = errors.New("smpp34: pdu is not a delivery receipt")
+
+// DlrStat is the one-word delivery status reported in a DLR's short
+// message body (or its message_state TLV).
+type DlrStat string
+
+const (
+	DLR_DELIVRD DlrStat = "DELIVRD"
+	DLR_EXPIRED DlrStat = "EXPIRED"
+	DLR_DELETED DlrStat = "DELETED"
+	DLR_UNDELIV DlrStat = "UNDELIV"
+	DLR_ACCEPTD DlrStat = "ACCEPTD"
+	DLR_REJECTD DlrStat = "REJECTD"
+	DLR_UNKNOWN DlrStat = "UNKNOWN"
+)
+
+// messageStateStat maps the message_state TLV's numeric values (SMPP
+// v3.4 section 5.2.28) onto the matching short-message stat string.
+// ENROUTE (1) has no textual stat analog among these and is omitted.
+var messageStateStat = map[byte]DlrStat{
+	2: DLR_DELIVRD,
+	3: DLR_EXPIRED,
+	4: DLR_DELETED,
+	5: DLR_UNDELIV,
+	6: DLR_ACCEPTD,
+	7: DLR_UNKNOWN,
+	8: DLR_REJECTD,
+}
+
+// DeliveryReceipt is the parsed form of a DELIVER_SM carrying an SMSC
+// delivery receipt, per SMPP v3.4 appendix B.
+type DeliveryReceipt struct {
+	SourceAddr      string
+	DestinationAddr string
+
+	Id         string // id:IIIIIIIIII
+	Sub        string // sub:SSS
+	Dlvrd      string // dlvrd:DDD
+	SubmitDate string // submit date:YYMMDDhhmm
+	DoneDate   string // done date:YYMMDDhhmm
+	Stat       DlrStat
+	Err        string // err:EEE
+	Text       string // text:.....
+}
+
+var dlrBodyRegexp = regexp.MustCompile(
+	`id:(?P<id>\S+)\s+sub:(?P<sub>\d+)\s+dlvrd:(?P<dlvrd>\d+)\s+` +
+		`submit date:(?P<submit>\d+)\s+done date:(?P<done>\d+)\s+` +
+		`stat:(?P<stat>\S+)\s+err:(?P<err>\S+)\s+text:(?P<text>.*)`,
+)
+
+// isDeliveryReceipt reports whether esmClass marks pdu as an SMSC
+// Delivery Receipt: bits 5-4-3-2 ("Message Type") equal to 0001 (0x04).
+func isDeliveryReceipt(esmClass byte) bool {
+	return esmClass&0x3C == 0x04
+}
+
+// ParseDeliveryReceipt recognises whether an inbound DELIVER_SM is an
+// SMSC delivery receipt (via esm_class, or the receipted_message_id /
+// message_state TLVs) and extracts its standard fields. TLV values, if
+// present, take precedence over the ones parsed from the short message
+// body.
+func ParseDeliveryReceipt(pdu Pdu) (*DeliveryReceipt, error) {
+	if pdu.GetHeader().Id != DELIVER_SM {
+		return nil, ErrNotDeliveryReceipt
+	}
+
+	tlvs := pdu.TLVFields()
+	_, hasReceiptedId := tlvs[TAG_RECEIPTED_MESSAGE_ID]
+	_, hasMessageState := tlvs[TAG_MESSAGE_STATE]
+
+	esmClass := fieldByte(pdu.GetField(ESM_CLASS))
+	if !isDeliveryReceipt(esmClass) && !hasReceiptedId && !hasMessageState {
+		return nil, ErrNotDeliveryReceipt
+	}
+
+	dlr := &DeliveryReceipt{
+		SourceAddr:      pdu.GetField(SOURCE_ADDR).String(),
+		DestinationAddr: pdu.GetField(DESTINATION_ADDR).String(),
+		Stat:            DLR_UNKNOWN,
+	}
+
+	if m := dlrBodyRegexp.FindStringSubmatch(pdu.GetField(SHORT_MESSAGE).String()); m != nil {
+		dlr.Id = m[1]
+		dlr.Sub = m[2]
+		dlr.Dlvrd = m[3]
+		dlr.SubmitDate = m[4]
+		dlr.DoneDate = m[5]
+		dlr.Stat = DlrStat(m[6])
+		dlr.Err = m[7]
+		dlr.Text = m[8]
+	}
+
+	if t, ok := tlvs[TAG_RECEIPTED_MESSAGE_ID]; ok {
+		dlr.Id = string(t.Value)
+	}
+
+	if t, ok := tlvs[TAG_MESSAGE_STATE]; ok && len(t.Value) > 0 {
+		if stat, ok := messageStateStat[t.Value[0]]; ok {
+			dlr.Stat = stat
+		}
+	}
+
+	return dlr, nil
+}
+
+// fieldByte returns the raw byte backing a single-byte Field such as
+// ESM_CLASS, as stored by NewFixedField.
+func fieldByte(f Field) byte {
+	s := f.String()
+	if len(s) == 0 {
+		return 0
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 0xFF {
+		return byte(n)
+	}
+
+	return s[0]
+}
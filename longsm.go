@@ -0,0 +1,203 @@
+package smpp34
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDH holds the raw User Data Header (including its length byte) of an
+// inbound short message whose esm_class marked it as UDHI, before the
+// header was stripped from SHORT_MESSAGE.
+const UDH = "udh"
+
+const (
+	gsm7Budget = 153 // septets, data_coding 0x00 (SMSC default / GSM 7-bit)
+	ucs2Budget = 67  // code units, data_coding 0x08
+	bin8Budget = 134 // octets, any other data_coding
+)
+
+// maxLongSmSegments is the largest number of parts a long message can
+// be split into: the UDH total byte and the sar_total_segments TLV
+// are both a single octet, so a segment count above this would wrap.
+const maxLongSmSegments = 255
+
+// ErrTooManySegments is returned by SubmitLongSm when text splits into
+// more parts than fit in the single-octet UDH total / sar_total_segments.
+var ErrTooManySegments = errors.New("smpp34: message too long, exceeds 255 segments")
+
+func segmentBudget(dataCoding int) int {
+	switch dataCoding {
+	case 0x08:
+		return ucs2Budget
+	case 0x00:
+		return gsm7Budget
+	default:
+		return bin8Budget
+	}
+}
+
+// splitLongSm breaks text into parts no larger than data_coding's
+// per-segment budget. UCS-2 is split on code units (runes), everything
+// else on bytes.
+func splitLongSm(text string, dataCoding int) []string {
+	budget := segmentBudget(dataCoding)
+
+	if dataCoding == 0x08 {
+		runes := []rune(text)
+		if len(runes) <= budget {
+			return []string{text}
+		}
+
+		parts := make([]string, 0, (len(runes)/budget)+1)
+		for i := 0; i < len(runes); i += budget {
+			end := i + budget
+			if end > len(runes) {
+				end = len(runes)
+			}
+			parts = append(parts, string(runes[i:end]))
+		}
+		return parts
+	}
+
+	b := []byte(text)
+	if len(b) <= budget {
+		return []string{text}
+	}
+
+	parts := make([]string, 0, (len(b)/budget)+1)
+	for i := 0; i < len(b); i += budget {
+		end := i + budget
+		if end > len(b) {
+			end = len(b)
+		}
+		parts = append(parts, string(b[i:end]))
+	}
+	return parts
+}
+
+// udhHeader builds the 6-byte concatenated-SM UDH: UDHL, IEI (0x00),
+// IEL (0x03), ref, total, seq.
+func udhHeader(ref, total, seq uint8) []byte {
+	return []byte{0x05, 0x00, 0x03, ref, total, seq}
+}
+
+// dataCodingOf and esmClassOf read DATA_CODING/ESM_CLASS as int, the
+// type validate_pdu_field_type requires Params to carry them as (see
+// the 0x00 case in validate_pdu_field).
+func dataCodingOf(params *Params) int {
+	if params == nil {
+		return 0
+	}
+	if dc, ok := (*params)[DATA_CODING].(int); ok {
+		return dc
+	}
+	return 0
+}
+
+func esmClassOf(params *Params) int {
+	if params == nil {
+		return 0
+	}
+	if ec, ok := (*params)[ESM_CLASS].(int); ok {
+		return ec
+	}
+	return 0
+}
+
+// withUDHIEsmClass returns a copy of params with the UDHI bit (bit 6,
+// 0x40) of esm_class set, preserving whatever else the caller set.
+func withUDHIEsmClass(params *Params) Params {
+	out := Params{}
+	if params != nil {
+		for k, v := range *params {
+			out[k] = v
+		}
+	}
+	out[ESM_CLASS] = esmClassOf(params) | 0x40
+	return out
+}
+
+// ---- inbound reassembly ----
+
+type longSmGroup struct {
+	total   uint8
+	parts   map[uint8]string
+	created time.Time
+}
+
+// longSmReassembler buffers UDHI-segmented fragments, keyed by source
+// address and UDH concat reference, until every fragment in the group
+// has arrived or it has sat incomplete for longer than ttl.
+type longSmReassembler struct {
+	mu     sync.Mutex
+	groups map[string]*longSmGroup
+}
+
+func newLongSmReassembler() *longSmReassembler {
+	return &longSmReassembler{groups: make(map[string]*longSmGroup)}
+}
+
+func longSmKey(sourceAddr string, ref uint8) string {
+	return fmt.Sprintf("%s:%d", sourceAddr, ref)
+}
+
+// Add records one fragment and returns the concatenated text once
+// every fragment of its group has arrived. Groups older than ttl are
+// dropped as a side effect of every call; ttl <= 0 disables the sweep.
+func (r *longSmReassembler) Add(sourceAddr string, ref, total, seq uint8, text string, ttl time.Duration) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ttl > 0 {
+		cutoff := time.Now().Add(-ttl)
+		for key, g := range r.groups {
+			if g.created.Before(cutoff) {
+				delete(r.groups, key)
+			}
+		}
+	}
+
+	key := longSmKey(sourceAddr, ref)
+	g, ok := r.groups[key]
+	if !ok {
+		g = &longSmGroup{total: total, parts: make(map[uint8]string), created: time.Now()}
+		r.groups[key] = g
+	}
+
+	g.parts[seq] = text
+
+	if uint8(len(g.parts)) < g.total {
+		return "", false
+	}
+
+	delete(r.groups, key)
+
+	var buf bytes.Buffer
+	for i := uint8(1); i <= g.total; i++ {
+		buf.WriteString(g.parts[i])
+	}
+
+	return buf.String(), true
+}
+
+// concatRefs hands out per-session monotonically-increasing concat
+// references: 8-bit for UDH mode, 16-bit for sar_* TLV mode. The two
+// kinds are independent counters: UDH and SAR references live in
+// unrelated namespaces, so sharing one would burn through the 8-bit
+// UDH space faster than the reassembler's collision-avoidance assumes.
+type concatRefs struct {
+	udh uint32
+	sar uint32
+}
+
+func (c *concatRefs) nextUDH() uint8 {
+	return uint8(atomic.AddUint32(&c.udh, 1))
+}
+
+func (c *concatRefs) nextSAR() uint16 {
+	return uint16(atomic.AddUint32(&c.sar, 1))
+}
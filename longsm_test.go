@@ -0,0 +1,72 @@
+package smpp34
+
+import "testing"
+
+func TestConcatRefsAreIndependent(t *testing.T) {
+	var c concatRefs
+
+	udh1 := c.nextUDH()
+	sar1 := c.nextSAR()
+	udh2 := c.nextUDH()
+
+	if udh1 != 1 || udh2 != 2 {
+		t.Errorf("nextUDH() sequence = %d, %d, want 1, 2 (unaffected by nextSAR)", udh1, udh2)
+	}
+	if sar1 != 1 {
+		t.Errorf("nextSAR() = %d, want 1", sar1)
+	}
+}
+
+func TestLongSmReassemblerAssemblesInOrder(t *testing.T) {
+	r := newLongSmReassembler()
+
+	if _, complete := r.Add("12345", 7, 3, 2, "second ", 0); complete {
+		t.Fatal("group reported complete after 1 of 3 fragments")
+	}
+	if _, complete := r.Add("12345", 7, 3, 1, "first ", 0); complete {
+		t.Fatal("group reported complete after 2 of 3 fragments")
+	}
+
+	text, complete := r.Add("12345", 7, 3, 3, "third", 0)
+	if !complete {
+		t.Fatal("group not reported complete after all 3 fragments arrived")
+	}
+	if text != "first second third" {
+		t.Errorf("reassembled text = %q, want %q", text, "first second third")
+	}
+}
+
+func TestLongSmReassemblerSeparatesBySourceAndRef(t *testing.T) {
+	r := newLongSmReassembler()
+
+	r.Add("12345", 1, 2, 1, "a", 0)
+	if _, complete := r.Add("67890", 1, 2, 1, "b", 0); complete {
+		t.Fatal("fragment from a different source_addr completed the wrong group")
+	}
+}
+
+func TestSplitLongSmBudgets(t *testing.T) {
+	gsm7 := make([]byte, gsm7Budget+10)
+	for i := range gsm7 {
+		gsm7[i] = 'a'
+	}
+	parts := splitLongSm(string(gsm7), 0x00)
+	if len(parts) != 2 {
+		t.Fatalf("gsm7 split into %d parts, want 2", len(parts))
+	}
+	if len(parts[0]) != gsm7Budget {
+		t.Errorf("first part is %d bytes, want %d", len(parts[0]), gsm7Budget)
+	}
+}
+
+func TestSplitLongSmCanExceedMaxSegments(t *testing.T) {
+	gsm7 := make([]byte, gsm7Budget*(maxLongSmSegments+1))
+	for i := range gsm7 {
+		gsm7[i] = 'a'
+	}
+
+	parts := splitLongSm(string(gsm7), 0x00)
+	if len(parts) <= maxLongSmSegments {
+		t.Fatalf("got %d parts, want more than maxLongSmSegments (%d) so SubmitLongSm's guard is exercised", len(parts), maxLongSmSegments)
+	}
+}
@@ -205,6 +205,7 @@ func create_pdu_fields(fieldNames []string, r *bytes.Buffer) (map[string]Field,
 
 						log.Debugf("This message is part of concat (header_len: %d) - (headers: %#v) - (message: %s)", udhip, p[:udhip], p[udhip:])
 
+						fields[UDH] = NewVariableField(p[:udhip])
 						msg = p[udhip:]
 					}
 				}
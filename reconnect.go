@@ -0,0 +1,53 @@
+package smpp34
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrReconnected is delivered to every Sync call still waiting on a
+// resp when the underlying connection is dropped and an automatic
+// reconnect begins, before it is known whether the reconnect succeeds;
+// the original request was lost and must be resent by the caller.
+var ErrReconnected = errors.New("smpp34: connection was lost and has been reconnected")
+
+// reconnectBindTimeout bounds a single bind attempt inside
+// handleDisconnect's retry loop (see Transceiver.rebind /
+// Transmitter.rebind).
+const reconnectBindTimeout = 5 * time.Second
+
+// ReconnectPolicy controls the backoff used to re-establish and rebind
+// a dropped connection. A nil policy (the default) disables automatic
+// reconnect: a dropped connection is simply closed, as before.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64 // applied to the delay after each failed attempt
+	Jitter       float64 // 0..1, randomizes each delay by +/- this fraction
+	MaxAttempts  int     // 0 means unlimited
+}
+
+func (p *ReconnectPolicy) nextDelay(delay time.Duration) time.Duration {
+	// A zero-value Multiplier (the unset default) would otherwise
+	// collapse every delay after the first attempt to ~0, turning
+	// backoff into a hot retry loop.
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	d := time.Duration(float64(delay) * mult)
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+func (p *ReconnectPolicy) jittered(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+	spread := (rand.Float64()*2 - 1) * p.Jitter * float64(delay)
+	return delay + time.Duration(spread)
+}
@@ -0,0 +1,54 @@
+package smpp34
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyNextDelay(t *testing.T) {
+	p := &ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     5 * time.Second,
+		Multiplier:   2,
+	}
+
+	got := p.nextDelay(time.Second)
+	if got != 2*time.Second {
+		t.Errorf("nextDelay(1s) = %v, want 2s", got)
+	}
+
+	got = p.nextDelay(4 * time.Second)
+	if got != p.MaxDelay {
+		t.Errorf("nextDelay(4s) = %v, want capped at MaxDelay %v", got, p.MaxDelay)
+	}
+}
+
+func TestReconnectPolicyNextDelayZeroMultiplierNoCollapse(t *testing.T) {
+	p := &ReconnectPolicy{InitialDelay: time.Second}
+
+	got := p.nextDelay(time.Second)
+	if got != time.Second {
+		t.Errorf("nextDelay with unset Multiplier = %v, want delay held at 1s, not collapsed", got)
+	}
+}
+
+func TestReconnectPolicyJitteredZeroIsNoop(t *testing.T) {
+	p := &ReconnectPolicy{}
+	if got := p.jittered(time.Second); got != time.Second {
+		t.Errorf("jittered with Jitter=0 = %v, want unchanged delay", got)
+	}
+}
+
+func TestReconnectPolicyJitteredStaysInRange(t *testing.T) {
+	p := &ReconnectPolicy{Jitter: 0.5}
+	delay := time.Second
+
+	for i := 0; i < 100; i++ {
+		got := p.jittered(delay)
+		low := delay - delay/2
+		high := delay + delay/2
+		if got < low || got > high {
+			t.Fatalf("jittered(%v) = %v, want within [%v, %v]", delay, got, low, high)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package smpp34
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// Authenticator validates the system_id/password pair presented in an
+// incoming bind PDU. Implementations are supplied by the application;
+// a common choice is a map or database lookup keyed on system_id.
+type Authenticator interface {
+	Authenticate(systemId, password string) bool
+}
+
+// Session is one bound SMPP connection accepted by a Server. It reuses
+// the Smpp PDU codec exactly like Transmitter/Transceiver do, but the
+// bind handshake runs server-side: the Server validates the incoming
+// bind against its Authenticator before a Session is ever handed to a
+// registered Handle func.
+type Session struct {
+	Smpp
+	Server   *Server
+	SystemId string
+	BindId   CMDId // BIND_TRANSMITTER, BIND_RECEIVER or BIND_TRANSCEIVER
+}
+
+// SubmitSmResp answers an inbound SubmitSm with the given message ID
+// and status.
+func (s *Session) SubmitSmResp(seq uint32, messageId string, status CMDStatus) error {
+	p, err := s.Smpp.SubmitSmResp(seq, messageId, status)
+	if err != nil {
+		return err
+	}
+
+	return s.Smpp.Write(p)
+}
+
+// DeliverSm pushes a mobile-terminated message to this Session, e.g.
+// to deliver a DLR or an MO forwarded from another ESME.
+func (s *Session) DeliverSm(source_addr, destination_addr, short_message string, params *Params) (seq uint32, err error) {
+	p, err := s.Smpp.DeliverSm(source_addr, destination_addr, short_message, params)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.Smpp.Write(p); err != nil {
+		return 0, err
+	}
+
+	return p.GetHeader().Sequence, nil
+}
+
+// Server is a minimal SMPP SMSC: it accepts connections, performs the
+// bind handshake against Auth, and dispatches every subsequent PDU to
+// whatever handler was registered for its command ID via Handle.
+// ENQUIRE_LINK and UNBIND are answered automatically and never reach a
+// registered handler.
+type Server struct {
+	Addr string
+	Auth Authenticator
+
+	handlers map[CMDId]func(*Session, Pdu)
+	ln       net.Listener
+}
+
+func NewServer(addr string, auth Authenticator) *Server {
+	return &Server{
+		Addr:     addr,
+		Auth:     auth,
+		handlers: make(map[CMDId]func(*Session, Pdu)),
+	}
+}
+
+// Handle registers h to be called for every inbound PDU with the
+// given command ID, for every Session accepted by this Server.
+func (srv *Server) Handle(cmdId CMDId, h func(*Session, Pdu)) {
+	srv.handlers[cmdId] = h
+}
+
+// ListenAndServe listens on srv.Addr and blocks serving connections
+// until the listener is closed.
+func (srv *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(ln)
+}
+
+func (srv *Server) Serve(ln net.Listener) error {
+	srv.ln = ln
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go srv.handleConn(conn)
+	}
+}
+
+func (srv *Server) Close() error {
+	if srv.ln == nil {
+		return nil
+	}
+
+	return srv.ln.Close()
+}
+
+func (srv *Server) handleConn(conn net.Conn) {
+	sess := &Session{Server: srv}
+	sess.Smpp = *NewSmpp(conn)
+
+	if err := sess.bind(); err != nil {
+		log.Debugln("[Server] bind handshake failed:", err)
+		sess.Smpp.Close()
+		return
+	}
+
+	for {
+		pdu, err := sess.Smpp.Read()
+		if err != nil {
+			log.Debugln("[Server] read failed, closing session:", err)
+			sess.Smpp.Close()
+			return
+		}
+
+		switch pdu.GetHeader().Id {
+		case ENQUIRE_LINK:
+			p, _ := sess.Smpp.EnquireLinkResp(pdu.GetHeader().Sequence)
+			sess.Smpp.Write(p)
+		case UNBIND:
+			p, _ := sess.Smpp.UnbindResp(pdu.GetHeader().Sequence)
+			sess.Smpp.Write(p)
+			sess.Smpp.Close()
+			return
+		default:
+			h, ok := srv.handlers[pdu.GetHeader().Id]
+			if !ok {
+				log.Debugf("[Server] no handler registered for %s", pdu.GetHeader().Id)
+				continue
+			}
+
+			h(sess, pdu)
+		}
+	}
+}
+
+// bind reads the first PDU on conn, which must be a BIND_*, validates
+// it against srv.Auth and replies with the matching BIND_*_RESP.
+func (s *Session) bind() error {
+	pdu, err := s.Smpp.Read()
+	if err != nil {
+		return err
+	}
+
+	switch pdu.GetHeader().Id {
+	case BIND_TRANSMITTER, BIND_RECEIVER, BIND_TRANSCEIVER:
+		s.BindId = pdu.GetHeader().Id
+	default:
+		return SmppBindRespErr
+	}
+
+	s.SystemId = pdu.GetField(SYSTEM_ID).String()
+	password := pdu.GetField(PASSWORD).String()
+
+	status := ESME_ROK
+	if s.Server.Auth == nil || !s.Server.Auth.Authenticate(s.SystemId, password) {
+		status = ESME_RINVPASWD
+	}
+
+	resp, err := s.Smpp.BindResp(s.BindId, pdu.GetHeader().Sequence, status)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Smpp.Write(resp); err != nil {
+		return err
+	}
+
+	if status != ESME_ROK {
+		return SmppBindAuthErr("Bind auth failed for system_id " + s.SystemId)
+	}
+
+	s.Bound = true
+
+	return nil
+}
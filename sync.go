@@ -0,0 +1,27 @@
+package smpp34
+
+import (
+	"errors"
+)
+
+// ErrSyncTimeout is returned by the Sync family of calls (SubmitSmSync,
+// QuerySmSync, UnbindSync, ...) when the SMSC does not answer the
+// outstanding request before the caller supplied timeout elapses.
+var ErrSyncTimeout = errors.New("smpp34: timed out waiting for response")
+
+// ErrConnClosed is delivered to every Sync call still waiting on a
+// response when the connection is closed out from under it.
+var ErrConnClosed = errors.New("smpp34: connection closed with requests in flight")
+
+// syncResult carries either the resp Pdu a Sync call was waiting for,
+// or the error that ended the wait, through the inflight channel.
+type syncResult struct {
+	pdu Pdu
+	err error
+}
+
+// isResponse reports whether id is an SMPP response command ID, i.e.
+// the original command ID with the top bit (0x80000000) set.
+func isResponse(id CMDId) bool {
+	return uint32(id)&0x80000000 != 0
+}
@@ -0,0 +1,21 @@
+package smpp34
+
+import "testing"
+
+func TestIsResponse(t *testing.T) {
+	cases := []struct {
+		id   CMDId
+		resp bool
+	}{
+		{CMDId(0x00000004), false}, // SUBMIT_SM
+		{CMDId(0x80000004), true},  // SUBMIT_SM_RESP
+		{CMDId(0x00000015), false}, // ENQUIRE_LINK
+		{CMDId(0x80000015), true},  // ENQUIRE_LINK_RESP
+	}
+
+	for _, c := range cases {
+		if got := isResponse(c.id); got != c.resp {
+			t.Errorf("isResponse(%#x) = %v, want %v", uint32(c.id), got, c.resp)
+		}
+	}
+}
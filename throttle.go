@@ -0,0 +1,55 @@
+package smpp34
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket gates callers to an average of rate tokens/sec, allowing
+// bursts up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSecond, burst int) *tokenBucket {
+	// burst <= 0 would otherwise cap tokens at 0 on every refill and
+	// Wait would never see a full token, blocking forever.
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   float64(perSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available, then consumes one.
+func (b *tokenBucket) Wait() {
+	for {
+		b.mu.Lock()
+
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
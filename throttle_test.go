@@ -0,0 +1,40 @@
+package smpp34
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstZeroClamped(t *testing.T) {
+	b := newTokenBucket(100, 0)
+
+	done := make(chan struct{})
+	go func() {
+		b.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() blocked forever with burst=0")
+	}
+}
+
+func TestTokenBucketAllowsBurstThenThrottles(t *testing.T) {
+	b := newTokenBucket(10, 3)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		b.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("first burst tokens took %v, want near-instant", elapsed)
+	}
+
+	start = time.Now()
+	b.Wait()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("4th call after exhausting burst took %v, want to wait for refill", elapsed)
+	}
+}
@@ -0,0 +1,11 @@
+package smpp34
+
+// Optional parameter tags (SMPP v3.4 section 5.3.2) used outside of
+// create_pdu_fields' mandatory-field walk.
+const (
+	TAG_RECEIPTED_MESSAGE_ID uint16 = 0x001E
+	TAG_MESSAGE_STATE        uint16 = 0x0427
+	TAG_SAR_MSG_REF_NUM      uint16 = 0x020C
+	TAG_SAR_TOTAL_SEGMENTS   uint16 = 0x020E
+	TAG_SAR_SEGMENT_SEQNUM   uint16 = 0x020F
+)
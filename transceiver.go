@@ -2,6 +2,8 @@ package smpp34
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +13,49 @@ type Transceiver struct {
 	eLCheckTimer *time.Timer  // Enquire Link Check timer
 	eLDuration   int          // Enquire Link Duration
 	Err          error        // Errors generated in go routines that lead to conn close
+
+	Inbox chan Pdu // Unsolicited PDUs (DeliverSm, ...) not claimed by a Sync call
+
+	inflight     map[uint32]chan syncResult
+	inflightMu   sync.Mutex
+	closed       chan struct{}
+	shuttingDown chan struct{} // closed by Close() to suppress a racing reconnect
+
+	reconnectMu  sync.Mutex
+	reconnectGen uint64 // bumped on every successful reconnect; read/written via sync/atomic
+
+	// WindowSize caps the number of SubmitSm/QuerySm/DeliverSm requests
+	// that may be outstanding (written but not yet resp'd) at once. A
+	// value of 0 means unlimited. It may be set any time before or
+	// after Bind.
+	WindowSize  uint
+	windowCount uint
+	windowed    map[uint32]struct{}
+	windowMu    sync.Mutex
+	windowCond  *sync.Cond
+
+	// ReassemblyTTL bounds how long an incomplete inbound concatenated
+	// message is buffered before being dropped. 0 disables the sweep.
+	ReassemblyTTL time.Duration
+
+	concatRefs  concatRefs
+	reassembler *longSmReassembler
+
+	limiter *tokenBucket
+
+	// Reconnect, when set, makes StartEnquireLink and demux reconnect
+	// and rebind (using the host/port/bind params passed to
+	// NewTransceiver) instead of closing the connection on error.
+	Reconnect *ReconnectPolicy
+	// OnReconnect, if set, is called after every reconnect attempt
+	// (err is nil on success).
+	OnReconnect func(attempt int, err error)
+
+	host         string
+	port         int
+	bindSystemId string
+	bindPassword string
+	bindParams   Params
 }
 
 // eli = EnquireLink Interval in Seconds
@@ -27,6 +72,12 @@ func NewTransceiver(host string, port int, eli int, bindParams Params) (*Transce
 		return nil, err
 	}
 
+	trx.host = host
+	trx.port = port
+	trx.bindSystemId = sysId
+	trx.bindPassword = pass
+	trx.bindParams = bindParams
+
 	// EnquireLinks should not be less 10seconds
 	if eli < 10 {
 		eli = 10
@@ -34,7 +85,18 @@ func NewTransceiver(host string, port int, eli int, bindParams Params) (*Transce
 
 	trx.eLDuration = eli
 
+	trx.Inbox = make(chan Pdu, 100)
+	trx.inflight = make(map[uint32]chan syncResult)
+	trx.closed = make(chan struct{})
+	trx.shuttingDown = make(chan struct{})
+	trx.windowed = make(map[uint32]struct{})
+	trx.windowCond = sync.NewCond(&trx.windowMu)
+
+	trx.ReassemblyTTL = 5 * time.Minute
+	trx.reassembler = newLongSmReassembler()
+
 	go trx.StartEnquireLink(eli)
+	go trx.demux()
 
 	return trx, nil
 }
@@ -68,6 +130,46 @@ func (t *Transceiver) Bind(system_id string, password string, params *Params) er
 	return nil
 }
 
+// rebind performs the same bind handshake as Bind, for use inside
+// handleDisconnect's retry loop. Unlike Bind, it does not spawn
+// bindCheck: an unanswered bind fails only this attempt, so the
+// backoff loop can retry it, instead of bindCheck's 5s timer tearing
+// down the connection via Close (which would also trip shuttingDown
+// and stop every further reconnect attempt regardless of
+// MaxAttempts/backoff).
+func (t *Transceiver) rebind(system_id string, password string, params *Params) error {
+	pdu, err := t.Smpp.Bind(BIND_TRANSCEIVER, system_id, password, params)
+	if err != nil {
+		return err
+	}
+	if err := t.Write(pdu); err != nil {
+		return err
+	}
+
+	ch := make(chan syncResult, 1)
+	go func() {
+		p, err := t.Smpp.Read()
+		ch <- syncResult{pdu: p, err: err}
+	}()
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return res.err
+		}
+		if res.pdu.GetHeader().Id != BIND_TRANSCEIVER_RESP {
+			return SmppBindRespErr
+		}
+		if !res.pdu.Ok() {
+			return SmppBindAuthErr("Bind auth failed. " + res.pdu.GetHeader().Status.Error())
+		}
+		t.Bound = true
+		return nil
+	case <-time.After(reconnectBindTimeout):
+		return ErrSyncTimeout
+	}
+}
+
 func (t *Transceiver) SubmitSm(source_addr, destination_addr, short_message string, params *Params) (seq uint32, err error) {
 	p, err := t.Smpp.SubmitSm(source_addr, destination_addr, short_message, params)
 
@@ -75,7 +177,51 @@ func (t *Transceiver) SubmitSm(source_addr, destination_addr, short_message stri
 		return 0, err
 	}
 
+	if err := t.acquireWindow(p.GetHeader().Sequence); err != nil {
+		return 0, err
+	}
+
 	if err := t.Write(p); err != nil {
+		t.releaseWindow(p.GetHeader().Sequence)
+		return 0, err
+	}
+
+	return p.GetHeader().Sequence, nil
+}
+
+// SubmitSmWait behaves like SubmitSm, but instead of returning
+// ErrMaxWindowSize when the window is full, it blocks until a slot
+// frees up.
+func (t *Transceiver) SubmitSmWait(source_addr, destination_addr, short_message string, params *Params) (seq uint32, err error) {
+	p, err := t.Smpp.SubmitSm(source_addr, destination_addr, short_message, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	t.waitWindow(p.GetHeader().Sequence)
+
+	if err := t.Write(p); err != nil {
+		t.releaseWindow(p.GetHeader().Sequence)
+		return 0, err
+	}
+
+	return p.GetHeader().Sequence, nil
+}
+
+func (t *Transceiver) QuerySm(message_id, source_addr string, params *Params) (seq uint32, err error) {
+	p, err := t.Smpp.QuerySm(message_id, source_addr, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.acquireWindow(p.GetHeader().Sequence); err != nil {
+		return 0, err
+	}
+
+	if err := t.Write(p); err != nil {
+		t.releaseWindow(p.GetHeader().Sequence)
 		return 0, err
 	}
 
@@ -89,15 +235,124 @@ func (t *Transceiver) DeliverSm(source_addr, destination_addr, short_message str
 		log.Debug("Transceiver: DeliverSm failed ", err)
 		return 0, err
 	}
+
+	if err := t.acquireWindow(p.GetHeader().Sequence); err != nil {
+		return 0, err
+	}
+
 	log.Debug("Transceiver: writing response")
 
 	if err := t.Write(p); err != nil {
+		t.releaseWindow(p.GetHeader().Sequence)
 		return 0, err
 	}
 
 	return p.GetHeader().Sequence, nil
 }
 
+// reassembleDeliverSm feeds a possibly UDHI-segmented DeliverSm into
+// t.reassembler. A pdu belonging to an incomplete group is swallowed
+// (nil, nil) until its siblings arrive, at which point the returned
+// pdu's SHORT_MESSAGE holds the full concatenated text. Non-segmented
+// messages pass through untouched.
+func (t *Transceiver) reassembleDeliverSm(pdu Pdu) (Pdu, error) {
+	udh := pdu.GetField(UDH)
+	if udh == nil {
+		return pdu, nil
+	}
+
+	h := []byte(udh.String())
+	if len(h) < 6 || h[1] != 0x00 || h[2] != 0x03 {
+		return pdu, nil
+	}
+
+	ref, total, seq := h[3], h[4], h[5]
+	sourceAddr := pdu.GetField(SOURCE_ADDR).String()
+
+	text, complete := t.reassembler.Add(sourceAddr, ref, total, seq, pdu.GetField(SHORT_MESSAGE).String(), t.ReassemblyTTL)
+	if !complete {
+		return nil, nil
+	}
+
+	if err := pdu.SetField(SHORT_MESSAGE, text); err != nil {
+		return nil, err
+	}
+
+	return pdu, nil
+}
+
+// SubmitLongSm splits text into parts sized per data_coding and sends
+// one SubmitSm per part, either as UDH-concatenated messages (the
+// default) or, when useSar is true, as sar_* TLV segments. It returns
+// the sequence number of every part written, in order, so the caller
+// can correlate the resulting SUBMIT_SM_RESPs.
+func (t *Transceiver) SubmitLongSm(source_addr, destination_addr, text string, params *Params, useSar bool) ([]uint32, error) {
+	parts := splitLongSm(text, dataCodingOf(params))
+
+	if len(parts) > maxLongSmSegments {
+		return nil, ErrTooManySegments
+	}
+
+	if len(parts) == 1 {
+		seq, err := t.SubmitSm(source_addr, destination_addr, parts[0], params)
+		if err != nil {
+			return nil, err
+		}
+		return []uint32{seq}, nil
+	}
+
+	seqs := make([]uint32, 0, len(parts))
+
+	if useSar {
+		ref := t.concatRefs.nextSAR()
+
+		for i, part := range parts {
+			p, err := t.Smpp.SubmitSm(source_addr, destination_addr, part, params)
+			if err != nil {
+				return seqs, err
+			}
+
+			if err := p.SetTLVField(int(TAG_SAR_MSG_REF_NUM), 2, packUi16(ref)); err != nil {
+				return seqs, err
+			}
+			if err := p.SetTLVField(int(TAG_SAR_TOTAL_SEGMENTS), 1, []byte{byte(len(parts))}); err != nil {
+				return seqs, err
+			}
+			if err := p.SetTLVField(int(TAG_SAR_SEGMENT_SEQNUM), 1, []byte{byte(i + 1)}); err != nil {
+				return seqs, err
+			}
+
+			if err := t.acquireWindow(p.GetHeader().Sequence); err != nil {
+				return seqs, err
+			}
+			if err := t.Write(p); err != nil {
+				t.releaseWindow(p.GetHeader().Sequence)
+				return seqs, err
+			}
+
+			seqs = append(seqs, p.GetHeader().Sequence)
+		}
+
+		return seqs, nil
+	}
+
+	ref := t.concatRefs.nextUDH()
+
+	for i, part := range parts {
+		partParams := withUDHIEsmClass(params)
+		msg := string(udhHeader(ref, uint8(len(parts)), uint8(i+1))) + part
+
+		seq, err := t.SubmitSm(source_addr, destination_addr, msg, &partParams)
+		if err != nil {
+			return seqs, err
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	return seqs, nil
+}
+
 func (t *Transceiver) DeliverSmResp(seq uint32, status CMDStatus, params *Params) error {
 	p, err := t.Smpp.DeliverSmResp(seq, status, params)
 
@@ -134,6 +389,123 @@ func (t *Transceiver) UnbindResp(seq uint32) error {
 	return nil
 }
 
+// SubmitSmSync behaves like SubmitSm but blocks until the matching
+// SUBMIT_SM_RESP is read off the wire by demux, or until timeout
+// elapses, in which case it returns ErrSyncTimeout.
+func (t *Transceiver) SubmitSmSync(source_addr, destination_addr, short_message string, params *Params, timeout time.Duration) (Pdu, error) {
+	seq, err := t.SubmitSm(source_addr, destination_addr, short_message, params)
+	return t.awaitResp(seq, err, timeout)
+}
+
+// QuerySmSync behaves like QuerySm but blocks for the QUERY_SM_RESP.
+func (t *Transceiver) QuerySmSync(message_id, source_addr string, params *Params, timeout time.Duration) (Pdu, error) {
+	seq, err := t.QuerySm(message_id, source_addr, params)
+	return t.awaitResp(seq, err, timeout)
+}
+
+// UnbindSync behaves like Unbind but blocks for the UNBIND_RESP.
+func (t *Transceiver) UnbindSync(timeout time.Duration) (Pdu, error) {
+	p, err := t.Smpp.Unbind()
+	if err != nil {
+		return nil, err
+	}
+
+	seq := p.GetHeader().Sequence
+	ch := t.registerInflight(seq)
+
+	if err := t.Write(p); err != nil {
+		t.forgetInflight(seq)
+		return nil, err
+	}
+
+	return t.waitInflight(seq, ch, timeout)
+}
+
+// registerInflight records a channel that demux will deliver the resp
+// for seq to, once it arrives.
+func (t *Transceiver) registerInflight(seq uint32) chan syncResult {
+	ch := make(chan syncResult, 1)
+
+	t.inflightMu.Lock()
+	t.inflight[seq] = ch
+	t.inflightMu.Unlock()
+
+	return ch
+}
+
+func (t *Transceiver) forgetInflight(seq uint32) {
+	t.inflightMu.Lock()
+	delete(t.inflight, seq)
+	t.inflightMu.Unlock()
+}
+
+// awaitResp registers seq and waits on its resp, short-circuiting if
+// the request itself already failed.
+func (t *Transceiver) awaitResp(seq uint32, err error, timeout time.Duration) (Pdu, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return t.waitInflight(seq, t.registerInflight(seq), timeout)
+}
+
+func (t *Transceiver) waitInflight(seq uint32, ch chan syncResult, timeout time.Duration) (Pdu, error) {
+	select {
+	case res := <-ch:
+		return res.pdu, res.err
+	case <-time.After(timeout):
+		t.forgetInflight(seq)
+		t.releaseWindow(seq)
+		return nil, ErrSyncTimeout
+	case <-t.closed:
+		return nil, ErrConnClosed
+	}
+}
+
+// acquireWindow reserves a window slot for seq, failing with
+// ErrMaxWindowSize if WindowSize is set and already full.
+func (t *Transceiver) acquireWindow(seq uint32) error {
+	t.windowMu.Lock()
+	defer t.windowMu.Unlock()
+
+	if t.WindowSize > 0 && t.windowCount >= t.WindowSize {
+		return ErrMaxWindowSize
+	}
+
+	t.windowCount++
+	t.windowed[seq] = struct{}{}
+
+	return nil
+}
+
+// waitWindow blocks until a window slot is free, then reserves it for seq.
+func (t *Transceiver) waitWindow(seq uint32) {
+	t.windowMu.Lock()
+	defer t.windowMu.Unlock()
+
+	for t.WindowSize > 0 && t.windowCount >= t.WindowSize {
+		t.windowCond.Wait()
+	}
+
+	t.windowCount++
+	t.windowed[seq] = struct{}{}
+}
+
+// releaseWindow frees the window slot held for seq, if any. Safe to
+// call for a seq that never held one, or more than once.
+func (t *Transceiver) releaseWindow(seq uint32) {
+	t.windowMu.Lock()
+	defer t.windowMu.Unlock()
+
+	if _, ok := t.windowed[seq]; !ok {
+		return
+	}
+
+	delete(t.windowed, seq)
+	t.windowCount--
+	t.windowCond.Broadcast()
+}
+
 func (t *Transceiver) GenericNack(seq uint32, status CMDStatus) error {
 	p, _ := t.Smpp.GenericNack(seq, status)
 
@@ -167,8 +539,15 @@ func (t *Transceiver) StartEnquireLink(eli int) {
 
 			p, _ := t.EnquireLink()
 			if err := t.Write(p); err != nil {
-				log.Debugln("[Transceiver.StartEnquireLink] error writing EnquireLink. Closing connection:", err)
+				log.Debugln("[Transceiver.StartEnquireLink] error writing EnquireLink:", err)
 				t.Err = SmppELWriteErr
+				if t.handleDisconnect(err) {
+					if t.eLCheckTimer != nil {
+						t.eLCheckTimer.Reset(d)
+					}
+					continue
+				}
+				log.Debugln("[Transceiver.StartEnquireLink] closing connection")
 				t.Close()
 				return
 			}
@@ -177,8 +556,13 @@ func (t *Transceiver) StartEnquireLink(eli int) {
 				t.eLCheckTimer.Reset(d)
 			}
 		case <-t.eLCheckTimer.C:
-			log.Debugln("[Transceiver.StartEnquireLink] timeout waiting for EnquireLinkResp. Closing connection:")
+			log.Debugln("[Transceiver.StartEnquireLink] timeout waiting for EnquireLinkResp.")
 			t.Err = SmppELRespErr
+			if t.handleDisconnect(t.Err) {
+				t.eLCheckTimer.Reset(d)
+				continue
+			}
+			log.Debugln("[Transceiver.StartEnquireLink] closing connection")
 			t.Close()
 			return
 		}
@@ -201,8 +585,10 @@ func (t *Transceiver) Read() (Pdu, error) {
 	}
 
 	switch pdu.GetHeader().Id {
-	case SUBMIT_SM_RESP, DELIVER_SM:
+	case SUBMIT_SM_RESP:
 		return pdu, nil
+	case DELIVER_SM:
+		return t.reassembleDeliverSm(pdu)
 	case ENQUIRE_LINK:
 		log.Debug("Transceiver ENQ")
 		p, _ := t.Smpp.EnquireLinkResp(pdu.GetHeader().Sequence)
@@ -219,6 +605,11 @@ func (t *Transceiver) Read() (Pdu, error) {
 		t.UnbindResp(pdu.GetHeader().Sequence)
 		t.Close()
 	default:
+		// Any other resp (UNBIND_RESP, QUERY_SM_RESP, ...) is handed
+		// back to the caller so demux can match it to a Sync call.
+		if isResponse(pdu.GetHeader().Id) {
+			return pdu, nil
+		}
 		// Should not have received these PDUs on a TRx bind
 		return nil, SmppPduErr
 	}
@@ -226,7 +617,92 @@ func (t *Transceiver) Read() (Pdu, error) {
 	return pdu, nil
 }
 
+// demux is the internal read loop started by NewTransceiver. It owns
+// Read() for the lifetime of the connection: resps matching an
+// outstanding Sync call are routed to that call, everything else
+// (DeliverSm, unmatched resps) is pushed onto Inbox for the caller's
+// own read loop.
+func (t *Transceiver) demux() {
+	for {
+		pdu, err := t.Read()
+		if err != nil {
+			if t.handleDisconnect(err) {
+				continue
+			}
+			t.closeInflight()
+			return
+		}
+		if pdu == nil {
+			continue
+		}
+
+		if !isResponse(pdu.GetHeader().Id) {
+			select {
+			case t.Inbox <- pdu:
+			case <-t.closed:
+				return
+			}
+			continue
+		}
+
+		seq := pdu.GetHeader().Sequence
+		t.releaseWindow(seq)
+
+		t.inflightMu.Lock()
+		ch, ok := t.inflight[seq]
+		if ok {
+			delete(t.inflight, seq)
+		}
+		t.inflightMu.Unlock()
+
+		if ok {
+			ch <- syncResult{pdu: pdu}
+			continue
+		}
+
+		select {
+		case t.Inbox <- pdu:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// closeInflight fails every outstanding Sync call with ErrConnClosed
+// and marks the connection closed. Safe to call more than once.
+func (t *Transceiver) closeInflight() {
+	t.inflightMu.Lock()
+	defer t.inflightMu.Unlock()
+
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+	}
+
+	for seq, ch := range t.inflight {
+		ch <- syncResult{err: ErrConnClosed}
+		delete(t.inflight, seq)
+	}
+
+	t.windowMu.Lock()
+	t.windowCount = 0
+	t.windowed = make(map[uint32]struct{})
+	t.windowCond.Broadcast()
+	t.windowMu.Unlock()
+}
+
 func (t *Transceiver) Close() {
+	// Signal first so a handleDisconnect racing against this Close()
+	// sees the shutdown and does not reconnect out from under us.
+	if t.shuttingDown != nil {
+		select {
+		case <-t.shuttingDown:
+		default:
+			close(t.shuttingDown)
+		}
+	}
+
 	// Check timers exists incase we Close() before timers are created
 	if t.eLCheckTimer != nil {
 		t.eLCheckTimer.Stop()
@@ -242,10 +718,127 @@ func (t *Transceiver) Close() {
 	}
 
 	t.Smpp.Close()
+
+	if t.inflight != nil {
+		t.closeInflight()
+	}
 }
 
 func (t *Transceiver) Write(p Pdu) error {
+	if t.limiter != nil {
+		t.limiter.Wait()
+	}
+
 	err := t.Smpp.Write(p)
 
 	return err
 }
+
+// RateLimit gates outbound PDU writes to an average of perSecond
+// writes/sec, allowing bursts up to burst. Call with perSecond <= 0 to
+// remove any previously set limit.
+func (t *Transceiver) RateLimit(perSecond, burst int) {
+	if perSecond <= 0 {
+		t.limiter = nil
+		return
+	}
+
+	t.limiter = newTokenBucket(perSecond, burst)
+}
+
+// handleDisconnect is called when cause breaks the connection (a
+// read/write error, or an EnquireLinkResp timeout). If Reconnect is
+// set it fails every outstanding Sync call with ErrReconnected, then
+// reconnects and rebinds with backoff, reporting each attempt via
+// OnReconnect. It returns true once the connection is usable again;
+// false means the caller should give up and close.
+//
+// StartEnquireLink and demux can both observe the same dropped
+// connection and call this concurrently; reconnectMu serializes the
+// actual reconnect attempt, and reconnectGen lets whichever goroutine
+// loses the race notice the other one already fixed the connection
+// instead of reconnecting a second time. A Close() racing either
+// goroutine is checked first so it always wins: once shuttingDown is
+// closed, no further reconnect is attempted.
+func (t *Transceiver) handleDisconnect(cause error) bool {
+	if t.Reconnect == nil {
+		return false
+	}
+
+	select {
+	case <-t.shuttingDown:
+		return false
+	default:
+	}
+
+	startGen := atomic.LoadUint64(&t.reconnectGen)
+
+	t.reconnectMu.Lock()
+	defer t.reconnectMu.Unlock()
+
+	select {
+	case <-t.shuttingDown:
+		return false
+	default:
+	}
+
+	if atomic.LoadUint64(&t.reconnectGen) != startGen {
+		// Another goroutine already reconnected while we waited for
+		// reconnectMu; the connection is fine again, nothing to do.
+		return true
+	}
+
+	t.failInflightForReconnect()
+
+	delay := t.Reconnect.InitialDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	for attempt := 1; t.Reconnect.MaxAttempts == 0 || attempt <= t.Reconnect.MaxAttempts; attempt++ {
+		select {
+		case <-t.shuttingDown:
+			return false
+		default:
+		}
+
+		t.Smpp.Close()
+
+		err := t.Connect(t.host, t.port)
+		if err == nil {
+			err = t.rebind(t.bindSystemId, t.bindPassword, &t.bindParams)
+		}
+
+		if t.OnReconnect != nil {
+			t.OnReconnect(attempt, err)
+		}
+
+		if err == nil {
+			atomic.StoreUint64(&t.reconnectGen, startGen+1)
+			return true
+		}
+
+		time.Sleep(t.Reconnect.jittered(delay))
+		delay = t.Reconnect.nextDelay(delay)
+	}
+
+	return false
+}
+
+// failInflightForReconnect fails every outstanding Sync call and
+// clears the send window, without tearing down t.closed: the
+// connection is about to be replaced, not shut down for good.
+func (t *Transceiver) failInflightForReconnect() {
+	t.inflightMu.Lock()
+	for seq, ch := range t.inflight {
+		ch <- syncResult{err: ErrReconnected}
+		delete(t.inflight, seq)
+	}
+	t.inflightMu.Unlock()
+
+	t.windowMu.Lock()
+	t.windowCount = 0
+	t.windowed = make(map[uint32]struct{})
+	t.windowCond.Broadcast()
+	t.windowMu.Unlock()
+}
@@ -0,0 +1,10 @@
+package smpp34
+
+import (
+	"errors"
+)
+
+// ErrMaxWindowSize is returned by the windowed send methods (SubmitSm,
+// QuerySm, DeliverSm) when WindowSize is set and the number of
+// requests already awaiting a resp has reached it.
+var ErrMaxWindowSize = errors.New("smpp34: max window size reached")